@@ -1,9 +1,14 @@
 package rollbar
 
 import (
+	"errors"
 	"fmt"
 )
 
+// ErrEmptyToken is recorded in RecentSends for items that were not sent
+// because Token is blank.
+var ErrEmptyToken = errors.New("rollbar: empty token")
+
 // ErrHTTPError is an HTTP error status code as defined by
 // http://www.w3.org/Protocols/rfc2616/rfc2616-sec10.html
 type ErrHTTPError int
@@ -12,3 +17,29 @@ type ErrHTTPError int
 func (e ErrHTTPError) Error() string {
 	return fmt.Sprintf("rollbar: service returned status: %d", e)
 }
+
+// WithClass wraps err so that it is reported to Rollbar with the given
+// exception class (e.g. "UpstreamTimeout") instead of one derived from err's
+// Go type. The override survives further wrapping with %w. WithClass returns
+// nil if err is nil, and err unchanged if class is blank.
+func WithClass(err error, class string) error {
+	if err == nil || class == "" {
+		return err
+	}
+	return &classedError{err: err, class: class}
+}
+
+type classedError struct {
+	err   error
+	class string
+}
+
+// Error implements the error interface.
+func (e *classedError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns the wrapped error.
+func (e *classedError) Unwrap() error {
+	return e.err
+}
@@ -2,15 +2,19 @@ package rollbar
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"os"
 	"reflect"
 	"regexp"
 	"runtime"
+	"runtime/debug"
 	"strings"
 	"sync"
 	"time"
@@ -58,6 +62,11 @@ var (
 	// also be application specific (client, heroku, etc.).
 	Platform = runtime.GOOS
 
+	// Hardware is an optional label for the hardware the binary is running on
+	// (e.g. "raspberry-pi-4", "graviton2"). It is reported alongside the
+	// detected runtime architecture.
+	Hardware = ""
+
 	// Endpoint is the URL destination for all Rollbar item POST requests.
 	Endpoint = "https://api.rollbar.com/api/1/item/"
 
@@ -68,23 +77,64 @@ var (
 
 	// FilterFields is a regular expression that matches field names that should
 	// not be sent to Rollbar. Values for these fields are replaced with
-	// "[FILTERED]".
+	// "[FILTERED]". Use SetFilterFields to change it while items are being
+	// reported.
 	FilterFields = regexp.MustCompile("password|secret|token")
 
 	// ErrorWriter is the destination for errors encountered while POSTing items
 	// to Rollbar. By default, this is stderr. This can be nil.
 	ErrorWriter io.Writer = os.Stderr
 
+	// Logger, if set, receives structured records for internal events (items
+	// enqueued, sent, failed, or dropped). Plain messages are still written to
+	// ErrorWriter regardless.
+	Logger *slog.Logger
+
+	// ValidatePayloads, when true, checks every item against the Rollbar item
+	// schema before it is POSTed and writes any violations to ErrorWriter. This
+	// is meant for tests and development.
+	ValidatePayloads = false
+
 	// CodeVersion is the optional code version reported to the Rollbar API for
 	// all items.
 	CodeVersion = ""
 
+	// LanguageVersion is the Go version reported to the Rollbar API for all
+	// items. It defaults to the version the binary was built with.
+	LanguageVersion = runtime.Version()
+
+	// Framework is the optional name of the framework or library wrapper in use
+	// (gin, echo, etc.) reported to the Rollbar API for all items.
+	Framework = ""
+
+	// FrameworkVersion is the optional version of Framework reported alongside
+	// it. It is ignored if Framework is blank.
+	FrameworkVersion = ""
+
+	// FingerprintEnvironment, when true, sends a fingerprint built from the
+	// error class, stacktrace, and Environment with every error so that
+	// identical errors in different environments are grouped separately in
+	// Rollbar. By default, Rollbar's own grouping is used.
+	FingerprintEnvironment = false
+
 	bodyChannel chan map[string]interface{}
 	waitGroup   sync.WaitGroup
 	postErrors  chan error
 	nilErrTitle = "<nil>"
+
+	readBuildInfo   = debug.ReadBuildInfo
+	buildInfoOnce   sync.Once
+	cachedBuildInfo map[string]interface{}
+
+	filterFieldsMu sync.RWMutex
+
+	recentSends   = make([]SendResult, 0, recentSendsSize)
+	recentSendsMu sync.Mutex
 )
 
+// recentSendsSize is the number of send outcomes kept for RecentSends.
+const recentSendsSize = 20
+
 // Field is a custom data field used to report arbitrary data to the Rollbar
 // API.
 type Field struct {
@@ -92,6 +142,15 @@ type Field struct {
 	Data interface{}
 }
 
+// SendResult is the outcome of a single POST of an item to the Rollbar API.
+type SendResult struct {
+	Time    time.Time
+	Status  int // HTTP status code, or 0 if no response was received
+	Latency time.Duration
+	UUID    string // item UUID assigned by Rollbar, if accepted
+	Err     error
+}
+
 // -- Setup
 
 func init() {
@@ -177,11 +236,12 @@ func buildError(level string, err error, stack Stack, fields ...*Field) map[stri
 	data := body["data"].(map[string]interface{})
 	errBody := errorBody(err, stack)
 	data["body"] = errBody
-
-	for _, field := range fields {
-		data[field.Name] = field.Data
+	if FingerprintEnvironment {
+		data["fingerprint"] = fingerprint(Environment, errorClass(err), stack)
 	}
 
+	setFields(data, fields)
+
 	return body
 }
 
@@ -189,26 +249,72 @@ func buildAndPushError(level string, err error, stack Stack, fields ...*Field) {
 	push(buildError(level, err, stack, fields...))
 }
 
+// GraphQLFields returns Fields describing a GraphQL operation, to be passed to
+// RequestError and friends. The operation name, if any, is reported as the
+// item's context so that errors are grouped by operation rather than by the
+// single GraphQL endpoint URL, and the variables are reported under
+// custom.graphql with values for field names matching FilterFields replaced.
+func GraphQLFields(operation string, variables map[string]interface{}) []*Field {
+	fields := []*Field{
+		{Name: "custom", Data: map[string]interface{}{
+			"graphql": map[string]interface{}{
+				"operation": operation,
+				"variables": filterMap(variables),
+			},
+		}},
+	}
+	if operation != "" {
+		fields = append(fields, &Field{Name: "context", Data: operation})
+	}
+	return fields
+}
+
 // -- Message reporting
 
 // Message asynchronously sends a message to Rollbar with the given severity
-// level.
-func Message(level string, msg string) {
+// level. You can pass, optionally, custom Fields (person, custom, context,
+// etc.) to be passed on to Rollbar.
+func Message(level string, msg string, fields ...*Field) {
+	push(buildMessage(level, msg, fields...))
+}
+
+func buildMessage(level string, msg string, fields ...*Field) map[string]interface{} {
 	body := buildBody(level, msg)
 	data := body["data"].(map[string]interface{})
 	data["body"] = messageBody(msg)
+	setFields(data, fields)
 
-	push(body)
+	return body
 }
 
 // -- Misc.
 
+// SetFilterFields replaces FilterFields. It is safe to call while items are
+// being reported.
+func SetFilterFields(re *regexp.Regexp) {
+	filterFieldsMu.Lock()
+	defer filterFieldsMu.Unlock()
+	FilterFields = re
+}
+
 // PostErrors returns a channel that receives all errors encountered while
 // POSTing items to the Rollbar API.
 func PostErrors() <-chan error {
 	return postErrors
 }
 
+// RecentSends returns the outcomes of the most recent POSTs to the Rollbar
+// API, oldest first. This is useful for exposing reporting health on an admin
+// or debug endpoint.
+func RecentSends() []SendResult {
+	recentSendsMu.Lock()
+	defer recentSendsMu.Unlock()
+
+	results := make([]SendResult, len(recentSends))
+	copy(results, recentSends)
+	return results
+}
+
 // Wait will block until the queue of errors / messages is empty. This allows
 // you to ensure that errors / messages are sent to Rollbar before exiting an
 // application.
@@ -222,16 +328,23 @@ func buildBody(level, title string) map[string]interface{} {
 	timestamp := time.Now().Unix()
 	hostname, _ := os.Hostname()
 
+	server := map[string]interface{}{
+		"host": hostname,
+		"arch": runtime.GOARCH,
+	}
+	if Hardware != "" {
+		server["hardware"] = Hardware
+	}
+
 	data := map[string]interface{}{
-		"environment": Environment,
-		"title":       title,
-		"level":       level,
-		"timestamp":   timestamp,
-		"platform":    Platform,
-		"language":    "go",
-		"server": map[string]interface{}{
-			"host": hostname,
-		},
+		"environment":      Environment,
+		"title":            title,
+		"level":            level,
+		"timestamp":        timestamp,
+		"platform":         Platform,
+		"language":         "go",
+		"language_version": LanguageVersion,
+		"server":           server,
 		"notifier": map[string]interface{}{
 			"name":    NAME,
 			"version": VERSION,
@@ -240,6 +353,12 @@ func buildBody(level, title string) map[string]interface{} {
 	if CodeVersion != "" {
 		data["code_version"] = CodeVersion
 	}
+	if Framework != "" {
+		data["framework"] = strings.TrimSpace(Framework + " " + FrameworkVersion)
+	}
+	if build := buildInfo(); build != nil {
+		data["custom"] = map[string]interface{}{"build": build}
+	}
 
 	return map[string]interface{}{
 		"access_token": Token,
@@ -247,6 +366,90 @@ func buildBody(level, title string) map[string]interface{} {
 	}
 }
 
+// setFields sets the given custom Fields on an item's data. A "custom" Field
+// whose data is a map with string keys is merged with any custom data that is
+// already present (such as custom.build); any other Field replaces the
+// existing value.
+func setFields(data map[string]interface{}, fields []*Field) {
+	for _, field := range fields {
+		if custom, ok := stringMap(field.Data); ok && field.Name == "custom" {
+			existing, _ := data["custom"].(map[string]interface{})
+			merged := make(map[string]interface{}, len(existing)+len(custom))
+			for k, v := range existing {
+				merged[k] = v
+			}
+			for k, v := range custom {
+				merged[k] = v
+			}
+			data["custom"] = merged
+			continue
+		}
+		data[field.Name] = field.Data
+	}
+}
+
+// stringMap converts any map with string keys to a map[string]interface{}.
+func stringMap(value interface{}) (map[string]interface{}, bool) {
+	if m, ok := value.(map[string]interface{}); ok {
+		return m, true
+	}
+
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Map || v.Type().Key().Kind() != reflect.String {
+		return nil, false
+	}
+
+	m := make(map[string]interface{}, v.Len())
+	iter := v.MapRange()
+	for iter.Next() {
+		m[iter.Key().String()] = iter.Value().Interface()
+	}
+	return m, true
+}
+
+// buildInfo returns a copy of the module version and VCS metadata embedded in
+// the running binary, or nil if it isn't available. The metadata is read once
+// and cached since it can't change while the process runs.
+func buildInfo() map[string]interface{} {
+	buildInfoOnce.Do(func() {
+		cachedBuildInfo = loadBuildInfo()
+	})
+	if cachedBuildInfo == nil {
+		return nil
+	}
+
+	build := make(map[string]interface{}, len(cachedBuildInfo))
+	for k, v := range cachedBuildInfo {
+		build[k] = v
+	}
+	return build
+}
+
+func loadBuildInfo() map[string]interface{} {
+	info, ok := readBuildInfo()
+	if !ok || info == nil {
+		return nil
+	}
+
+	build := map[string]interface{}{}
+	if info.Main.Version != "" {
+		build["version"] = info.Main.Version
+	}
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision", "vcs.time":
+			build[setting.Key] = setting.Value
+		case "vcs.modified":
+			build[setting.Key] = setting.Value == "true"
+		}
+	}
+	if len(build) == 0 {
+		return nil
+	}
+
+	return build
+}
+
 // errorBody generates a Rollbar error body with a given stack trace.
 func errorBody(err error, stack Stack) map[string]interface{} {
 	message := nilErrTitle
@@ -289,8 +492,12 @@ func errorRequest(r *http.Request) map[string]interface{} {
 // filterParams filters sensitive information like passwords from being sent to
 // Rollbar.
 func filterParams(values map[string][]string) map[string][]string {
+	filterFieldsMu.RLock()
+	filter := FilterFields
+	filterFieldsMu.RUnlock()
+
 	for key := range values {
-		if FilterFields.Match([]byte(key)) {
+		if filter.Match([]byte(key)) {
 			values[key] = []string{FILTERED}
 		}
 	}
@@ -298,6 +505,41 @@ func filterParams(values map[string][]string) map[string][]string {
 	return values
 }
 
+// filterMap returns a copy of the given map, and any nested maps or lists,
+// with values for sensitive keys replaced.
+func filterMap(values map[string]interface{}) map[string]interface{} {
+	filterFieldsMu.RLock()
+	filter := FilterFields
+	filterFieldsMu.RUnlock()
+
+	result := make(map[string]interface{}, len(values))
+	for key, value := range values {
+		if filter.Match([]byte(key)) {
+			result[key] = FILTERED
+		} else {
+			result[key] = filterValue(value)
+		}
+	}
+
+	return result
+}
+
+// filterValue filters sensitive keys from maps found within the given value.
+func filterValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return filterMap(v)
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, elem := range v {
+			result[i] = filterValue(elem)
+		}
+		return result
+	default:
+		return value
+	}
+}
+
 func flattenValues(values map[string][]string) map[string]interface{} {
 	result := make(map[string]interface{})
 
@@ -325,6 +567,10 @@ func errorClass(err error) string {
 	if err == nil {
 		return nilErrTitle
 	}
+	var classed *classedError
+	if errors.As(err, &classed) {
+		return classed.class
+	}
 
 	class := reflect.TypeOf(err).String()
 	if class == "" {
@@ -341,39 +587,90 @@ func push(body map[string]interface{}) {
 	if len(bodyChannel) < Buffer {
 		waitGroup.Add(1)
 		bodyChannel <- body
+		logEvent(slog.LevelDebug, "rollbar: item enqueued", "queued", len(bodyChannel))
 	} else {
 		stderr("buffer full, dropping error on the floor")
+		logEvent(slog.LevelWarn, "rollbar: item dropped", "reason", "buffer full")
 	}
 }
 
 // POST the given JSON body to Rollbar synchronously.
 func post(body map[string]interface{}) error {
+	if ValidatePayloads {
+		for _, err := range validateBody(body) {
+			stderr("invalid payload: %s", err.Error())
+		}
+	}
+
 	if len(Token) == 0 {
 		stderr("empty token")
+		logEvent(slog.LevelWarn, "rollbar: item dropped", "reason", "empty token")
+		recordSend(SendResult{Time: time.Now(), Err: ErrEmptyToken})
 		return nil
 	}
 
 	jsonBody, err := json.Marshal(body)
 	if err != nil {
 		stderr("failed to encode payload: %s", err.Error())
+		logEvent(slog.LevelWarn, "rollbar: item dropped", "reason", "encode failed", "error", err)
+		recordSend(SendResult{Time: time.Now(), Err: err})
 		return err
 	}
 
+	start := time.Now()
 	resp, err := http.Post(Endpoint, "application/json", bytes.NewReader(jsonBody))
 	if err != nil {
 		stderr("POST failed: %s", err.Error())
+		logEvent(slog.LevelError, "rollbar: send failed", "error", err)
+		recordSend(SendResult{Time: start, Latency: time.Since(start), Err: err})
 		return err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
 		stderr("received response: %s", resp.Status)
-		return ErrHTTPError(resp.StatusCode)
+		logEvent(slog.LevelError, "rollbar: send failed", "status", resp.StatusCode)
+		err = ErrHTTPError(resp.StatusCode)
+		recordSend(SendResult{Time: start, Status: resp.StatusCode, Latency: time.Since(start), Err: err})
+		return err
+	}
+
+	var result struct {
+		Result struct {
+			UUID string `json:"uuid"`
+		} `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		stderr("failed to decode response: %s", err.Error())
 	}
 
+	logEvent(slog.LevelInfo, "rollbar: item sent", "status", resp.StatusCode)
+	recordSend(SendResult{Time: start, Status: resp.StatusCode, Latency: time.Since(start), UUID: result.Result.UUID})
 	return nil
 }
 
+// recordSend appends the given outcome to the ring of recent sends, evicting
+// the oldest one when full.
+func recordSend(result SendResult) {
+	recentSendsMu.Lock()
+	defer recentSendsMu.Unlock()
+
+	if len(recentSends) == recentSendsSize {
+		copy(recentSends, recentSends[1:])
+		recentSends = recentSends[:recentSendsSize-1]
+	}
+	recentSends = append(recentSends, result)
+}
+
+// -- Logging
+
+// logEvent emits a structured record for an internal event to Logger, if set.
+func logEvent(level slog.Level, msg string, args ...interface{}) {
+	if Logger != nil {
+		Logger.Log(context.Background(), level, msg, args...)
+	}
+}
+
 // -- stderr
 func stderr(format string, args ...interface{}) {
 	if ErrorWriter != nil {
@@ -1,10 +1,21 @@
 package rollbar
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
+	"regexp"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
 	"testing"
 )
 
@@ -156,9 +167,9 @@ func TestCustomField(t *testing.T) {
 		t.Error("should have field 'custom'")
 	}
 
-	customMap, ok := custom.(map[string]string)
+	customMap, ok := custom.(map[string]interface{})
 	if !ok {
-		t.Error("should be a map[string]string")
+		t.Error("should be a map[string]interface{}")
 	}
 
 	val, ok := customMap["NAME1"]
@@ -199,3 +210,554 @@ func TestErrorRead(t *testing.T) {
 
 	Wait()
 }
+
+func TestFramework(t *testing.T) {
+	bckName, bckVersion := Framework, FrameworkVersion
+	defer func() {
+		Framework, FrameworkVersion = bckName, bckVersion
+	}()
+
+	data := buildBody(ERR, "test")["data"].(map[string]interface{})
+	if _, ok := data["framework"]; ok {
+		t.Error("should not have field 'framework' when Framework is blank")
+	}
+
+	Framework, FrameworkVersion = "gin", "1.9.1"
+	data = buildBody(ERR, "test")["data"].(map[string]interface{})
+	if data["framework"] != "gin 1.9.1" {
+		t.Errorf("got framework: %v", data["framework"])
+	}
+
+	FrameworkVersion = ""
+	data = buildBody(ERR, "test")["data"].(map[string]interface{})
+	if data["framework"] != "gin" {
+		t.Errorf("got framework: %v", data["framework"])
+	}
+
+	if data["language_version"] != runtime.Version() {
+		t.Errorf("got language_version: %v", data["language_version"])
+	}
+
+	bckLanguageVersion := LanguageVersion
+	defer func() {
+		LanguageVersion = bckLanguageVersion
+	}()
+	LanguageVersion = "go1.12.5"
+	data = buildBody(ERR, "test")["data"].(map[string]interface{})
+	if data["language_version"] != "go1.12.5" {
+		t.Errorf("got language_version: %v", data["language_version"])
+	}
+}
+
+func TestFingerprintEnvironment(t *testing.T) {
+	bckEnabled, bckEnv := FingerprintEnvironment, Environment
+	defer func() {
+		FingerprintEnvironment, Environment = bckEnabled, bckEnv
+	}()
+
+	stack := BuildStack(0)
+	fingerprintIn := func(env string) (interface{}, bool) {
+		Environment = env
+		data := buildError(ERR, errors.New("test"), stack)["data"].(map[string]interface{})
+		fp, ok := data["fingerprint"]
+		return fp, ok
+	}
+
+	FingerprintEnvironment = false
+	if _, ok := fingerprintIn("production"); ok {
+		t.Error("should not have field 'fingerprint' when disabled")
+	}
+	if _, ok := fingerprintIn("staging"); ok {
+		t.Error("should not have field 'fingerprint' when disabled")
+	}
+
+	FingerprintEnvironment = true
+	production, _ := fingerprintIn("production")
+	staging, _ := fingerprintIn("staging")
+	if production == staging {
+		t.Errorf("should differ across environments, got %v", production)
+	}
+	if again, _ := fingerprintIn("production"); again != production {
+		t.Errorf("should be stable, got %v and %v", production, again)
+	}
+
+	Environment = "production"
+	generic := buildError(ERR, errors.New("test"), stack)["data"].(map[string]interface{})
+	custom := buildError(ERR, &CustomError{"test"}, stack)["data"].(map[string]interface{})
+	if generic["fingerprint"] == custom["fingerprint"] {
+		t.Errorf("should differ across error classes, got %v", generic["fingerprint"])
+	}
+}
+
+type recordHandler struct {
+	mu      sync.Mutex
+	records []slog.Record
+}
+
+func (h *recordHandler) Enabled(context.Context, slog.Level) bool { return true }
+func (h *recordHandler) WithAttrs([]slog.Attr) slog.Handler       { return h }
+func (h *recordHandler) WithGroup(string) slog.Handler            { return h }
+
+func (h *recordHandler) Handle(_ context.Context, r slog.Record) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.records = append(h.records, r)
+	return nil
+}
+
+func (h *recordHandler) messages() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	msgs := make([]string, 0, len(h.records))
+	for _, r := range h.records {
+		msgs = append(msgs, r.Message)
+	}
+	return msgs
+}
+
+func (h *recordHandler) reasons() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var reasons []string
+	for _, r := range h.records {
+		r.Attrs(func(a slog.Attr) bool {
+			if a.Key == "reason" {
+				reasons = append(reasons, a.Value.String())
+			}
+			return true
+		})
+	}
+	return reasons
+}
+
+func TestLogger(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	bckLogger, bckToken, bckEP, bckBuffer := Logger, Token, Endpoint, Buffer
+	defer func() {
+		Logger, Token, Endpoint, Buffer = bckLogger, bckToken, bckEP, bckBuffer
+	}()
+
+	handler := &recordHandler{}
+	Logger = slog.New(handler)
+	Token = "test"
+	Endpoint = server.URL
+
+	if err := post(buildBody(ERR, "test")); err != nil {
+		t.Fatal(err)
+	}
+
+	Buffer = 0
+	push(buildBody(ERR, "test"))
+
+	body := buildBody(ERR, "test")
+	body["data"].(map[string]interface{})["custom"] = map[string]interface{}{"ch": make(chan int)}
+	post(body)
+
+	Token = ""
+	post(buildBody(ERR, "test"))
+
+	msgs := handler.messages()
+	expected := []string{"rollbar: item sent", "rollbar: item dropped", "rollbar: item dropped", "rollbar: item dropped"}
+	if fmt.Sprint(msgs) != fmt.Sprint(expected) {
+		t.Errorf("got records: %v", msgs)
+	}
+
+	reasons := handler.reasons()
+	if fmt.Sprint(reasons) != fmt.Sprint([]string{"buffer full", "encode failed", "empty token"}) {
+		t.Errorf("got drop reasons: %v", reasons)
+	}
+}
+
+func TestServerArch(t *testing.T) {
+	bckHardware := Hardware
+	defer func() {
+		Hardware = bckHardware
+	}()
+
+	Hardware = ""
+	server := buildBody(ERR, "test")["data"].(map[string]interface{})["server"].(map[string]interface{})
+	if server["arch"] != runtime.GOARCH {
+		t.Errorf("got arch: %v", server["arch"])
+	}
+	if _, ok := server["hardware"]; ok {
+		t.Error("should not have field 'hardware' when Hardware is blank")
+	}
+
+	Hardware = "raspberry-pi-4"
+	server = buildBody(ERR, "test")["data"].(map[string]interface{})["server"].(map[string]interface{})
+	if server["arch"] != runtime.GOARCH {
+		t.Errorf("got arch: %v", server["arch"])
+	}
+	if server["hardware"] != "raspberry-pi-4" {
+		t.Errorf("got hardware: %v", server["hardware"])
+	}
+}
+
+func TestMessageFields(t *testing.T) {
+	body := buildMessage(INFO, "test-message",
+		&Field{Name: "person", Data: map[string]string{"id": "42", "username": "alice"}},
+		&Field{Name: "custom", Data: map[string]interface{}{"tags": []string{"billing"}, "plan": "pro"}},
+		&Field{Name: "context", Data: "billing#charge"},
+	)
+
+	jsonBody, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded struct {
+		Data struct {
+			Title   string `json:"title"`
+			Context string `json:"context"`
+			Person  struct {
+				ID       string `json:"id"`
+				Username string `json:"username"`
+			} `json:"person"`
+			Custom struct {
+				Tags []string `json:"tags"`
+				Plan string   `json:"plan"`
+			} `json:"custom"`
+			Body map[string]map[string]interface{} `json:"body"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(jsonBody, &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	data := decoded.Data
+	if data.Title != "test-message" {
+		t.Errorf("got title: %s", data.Title)
+	}
+	if data.Context != "billing#charge" {
+		t.Errorf("got context: %s", data.Context)
+	}
+	if data.Person.ID != "42" || data.Person.Username != "alice" {
+		t.Errorf("got person: %+v", data.Person)
+	}
+	if len(data.Custom.Tags) != 1 || data.Custom.Tags[0] != "billing" || data.Custom.Plan != "pro" {
+		t.Errorf("got custom: %+v", data.Custom)
+	}
+	if _, ok := data.Body["trace"]; ok {
+		t.Error("should not have a trace body")
+	}
+	if data.Body["message"]["body"] != "test-message" {
+		t.Errorf("got message body: %v", data.Body["message"])
+	}
+}
+
+func TestRecentSends(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			return
+		}
+		if r.URL.Path == "/garbled" {
+			fmt.Fprint(w, "<html>")
+			return
+		}
+		fmt.Fprint(w, `{"err": 0, "result": {"uuid": "abc123"}}`)
+	}))
+	defer server.Close()
+
+	bckToken, bckEP := Token, Endpoint
+	defer func() {
+		Token, Endpoint = bckToken, bckEP
+	}()
+	Token = "test"
+
+	Endpoint = server.URL
+	post(buildBody(ERR, "test"))
+	Endpoint = server.URL + "/fail"
+	post(buildBody(ERR, "test"))
+
+	recent := RecentSends()
+	if len(recent) < 2 {
+		t.Fatalf("got %d recent sends", len(recent))
+	}
+	ok, failed := recent[len(recent)-2], recent[len(recent)-1]
+	if ok.Status != 200 || ok.UUID != "abc123" || ok.Err != nil || ok.Time.IsZero() {
+		t.Errorf("got successful send: %+v", ok)
+	}
+	if failed.Status != 422 || failed.UUID != "" || failed.Err != ErrHTTPError(422) {
+		t.Errorf("got failed send: %+v", failed)
+	}
+
+	bckWriter := ErrorWriter
+	var out bytes.Buffer
+	ErrorWriter = &out
+	Endpoint = server.URL + "/garbled"
+	post(buildBody(ERR, "test"))
+	ErrorWriter = bckWriter
+	recent = RecentSends()
+	if garbled := recent[len(recent)-1]; garbled.Status != 200 || garbled.UUID != "" || garbled.Err != nil {
+		t.Errorf("got garbled response send: %+v", garbled)
+	}
+	if !strings.Contains(out.String(), "failed to decode response") {
+		t.Errorf("should report the decode error, got %q", out.String())
+	}
+	Endpoint = server.URL
+
+	body := buildBody(ERR, "test")
+	body["data"].(map[string]interface{})["custom"] = map[string]interface{}{"ch": make(chan int)}
+	if err := post(body); err == nil {
+		t.Error("should fail to encode")
+	}
+	recent = RecentSends()
+	if encode := recent[len(recent)-1]; encode.Err == nil || encode.Status != 0 {
+		t.Errorf("got encode failure: %+v", encode)
+	}
+
+	Token = ""
+	post(buildBody(ERR, "test"))
+	recent = RecentSends()
+	if empty := recent[len(recent)-1]; empty.Err != ErrEmptyToken {
+		t.Errorf("got empty token send: %+v", empty)
+	}
+	Token = "test"
+
+	Endpoint = server.URL
+	for i := 0; i < recentSendsSize+5; i++ {
+		post(buildBody(ERR, "test"))
+	}
+	if len(RecentSends()) != recentSendsSize {
+		t.Errorf("should be bounded to %d, got %d", recentSendsSize, len(RecentSends()))
+	}
+}
+
+func TestNilError(t *testing.T) {
+	Error(ERR, nil)
+	RequestError(ERR, &http.Request{URL: &url.URL{}}, nil)
+
+	body := buildError(ERR, nil, BuildStack(1))
+	data := body["data"].(map[string]interface{})
+	if data["title"] != nilErrTitle {
+		t.Errorf("got title: %v", data["title"])
+	}
+
+	trace := data["body"].(map[string]interface{})["trace"].(map[string]interface{})
+	exception := trace["exception"].(map[string]interface{})
+	if exception["class"] != nilErrTitle || exception["message"] != nilErrTitle {
+		t.Errorf("got exception: %v", exception)
+	}
+
+	frames := trace["frames"].(Stack)
+	if len(frames) == 0 || frames[0].Method != "rollbar.TestNilError" {
+		t.Errorf("should point at the calling site, got %v", frames)
+	}
+
+	Wait()
+}
+
+func TestBuildInfo(t *testing.T) {
+	bckReadBuildInfo := readBuildInfo
+	defer func() {
+		readBuildInfo = bckReadBuildInfo
+		buildInfoOnce = sync.Once{}
+	}()
+
+	buildInfoOnce = sync.Once{}
+	readBuildInfo = func() (*debug.BuildInfo, bool) { return nil, false }
+	data := buildBody(ERR, "test")["data"].(map[string]interface{})
+	if _, ok := data["custom"]; ok {
+		t.Error("should not have field 'custom' without build info")
+	}
+
+	reads := 0
+	buildInfoOnce = sync.Once{}
+	readBuildInfo = func() (*debug.BuildInfo, bool) {
+		reads++
+		return &debug.BuildInfo{
+			Main: debug.Module{Path: "example.com/app", Version: "v1.2.3"},
+			Settings: []debug.BuildSetting{
+				{Key: "vcs.revision", Value: "0123abcd"},
+				{Key: "vcs.time", Value: "2019-06-11T10:00:00Z"},
+				{Key: "vcs.modified", Value: "true"},
+				{Key: "GOOS", Value: "linux"},
+			},
+		}, true
+	}
+	body := buildError(ERR, errors.New("test"), BuildStack(0), &Field{
+		Name: "custom",
+		Data: map[string]interface{}{"NAME1": "VALUE1"},
+	})
+	custom := body["data"].(map[string]interface{})["custom"].(map[string]interface{})
+	if custom["NAME1"] != "VALUE1" {
+		t.Errorf("should keep custom fields, got %v", custom)
+	}
+
+	build := custom["build"].(map[string]interface{})
+	expected := map[string]interface{}{
+		"version":      "v1.2.3",
+		"vcs.revision": "0123abcd",
+		"vcs.time":     "2019-06-11T10:00:00Z",
+		"vcs.modified": true,
+	}
+	if len(build) != len(expected) {
+		t.Errorf("got build: %v", build)
+	}
+	for k, v := range expected {
+		if build[k] != v {
+			t.Errorf("got build[%q]: %v", k, build[k])
+		}
+	}
+
+	body = buildError(ERR, errors.New("test"), BuildStack(0), &Field{
+		Name: "custom",
+		Data: map[string]string{"NAME1": "VALUE1"},
+	})
+	custom = body["data"].(map[string]interface{})["custom"].(map[string]interface{})
+	if custom["NAME1"] != "VALUE1" || custom["build"] == nil {
+		t.Errorf("should merge map[string]string custom fields with build info, got %v", custom)
+	}
+
+	build["version"] = "changed"
+	custom = buildBody(ERR, "test")["data"].(map[string]interface{})["custom"].(map[string]interface{})
+	if version := custom["build"].(map[string]interface{})["version"]; version != "v1.2.3" {
+		t.Errorf("should give each item its own copy, got version %v", version)
+	}
+	if reads != 1 {
+		t.Errorf("should read build info once, read %d times", reads)
+	}
+}
+
+func TestSetFilterFields(t *testing.T) {
+	bckFilter := FilterFields
+	defer SetFilterFields(bckFilter)
+
+	done := make(chan bool)
+	go func() {
+		for i := 0; i < 100; i++ {
+			SetFilterFields(regexp.MustCompile("password|secret"))
+			SetFilterFields(regexp.MustCompile("password|token"))
+		}
+		done <- true
+	}()
+
+	r, _ := http.NewRequest("GET", "http://foo.com/somethere?password=hunter2", nil)
+	for i := 0; i < 100; i++ {
+		object := errorRequest(r)
+		if object["GET"].(map[string]interface{})["password"] != FILTERED {
+			t.Fatal("should filter password parameter")
+		}
+	}
+	<-done
+
+	SetFilterFields(regexp.MustCompile("ssn"))
+	clean := filterParams(map[string][]string{"ssn": {"one"}, "password": {"one"}})
+	if clean["ssn"][0] != FILTERED || clean["password"][0] == FILTERED {
+		t.Errorf("should use the new filter, got %v", clean)
+	}
+}
+
+func TestWithClass(t *testing.T) {
+	err := WithClass(&CustomError{"upstream took too long"}, "UpstreamTimeout")
+
+	data := buildError(ERR, err, BuildStack(0))["data"].(map[string]interface{})
+	if data["title"] != "upstream took too long" {
+		t.Errorf("got title: %v", data["title"])
+	}
+
+	trace := data["body"].(map[string]interface{})["trace"].(map[string]interface{})
+	exception := trace["exception"].(map[string]interface{})
+	if exception["class"] != "UpstreamTimeout" {
+		t.Errorf("got class: %v", exception["class"])
+	}
+	if exception["message"] != "upstream took too long" {
+		t.Errorf("got message: %v", exception["message"])
+	}
+
+	var custom *CustomError
+	if !errors.As(err, &custom) {
+		t.Error("should unwrap to the original error")
+	}
+
+	if WithClass(nil, "UpstreamTimeout") != nil {
+		t.Error("should return nil for a nil error")
+	}
+
+	wrapped := fmt.Errorf("fetching user: %w", err)
+	if errorClass(wrapped) != "UpstreamTimeout" {
+		t.Errorf("should keep the override when wrapped, got %s", errorClass(wrapped))
+	}
+
+	if class := errorClass(WithClass(&CustomError{"test"}, "")); class != "rollbar.CustomError" {
+		t.Errorf("should fall back to the Go type for a blank class, got %s", class)
+	}
+}
+
+func TestGraphQLFields(t *testing.T) {
+	r, _ := http.NewRequest("POST", "http://foo.com/graphql", nil)
+	variables := map[string]interface{}{
+		"email":    "alice@example.com",
+		"password": "hunter2",
+		"input": map[string]interface{}{
+			"name":         "alice",
+			"secret_token": "abc",
+		},
+		"users": []interface{}{
+			map[string]interface{}{"name": "bob", "password": "hunter3"},
+			"carol",
+		},
+	}
+
+	fields := append(GraphQLFields("CreateUser", variables), &Field{
+		Name: "custom",
+		Data: map[string]interface{}{"NAME1": "VALUE1"},
+	})
+	fields = append(fields, &Field{Name: "request", Data: errorRequest(r)})
+	data := buildError(ERR, errors.New("test"), BuildStack(0), fields...)["data"].(map[string]interface{})
+
+	if data["context"] != "CreateUser" {
+		t.Errorf("got context: %v", data["context"])
+	}
+
+	custom := data["custom"].(map[string]interface{})
+	if custom["NAME1"] != "VALUE1" {
+		t.Errorf("should keep custom fields, got %v", custom)
+	}
+
+	graphql := custom["graphql"].(map[string]interface{})
+	if graphql["operation"] != "CreateUser" {
+		t.Errorf("got operation: %v", graphql["operation"])
+	}
+	vars := graphql["variables"].(map[string]interface{})
+	if vars["email"] != "alice@example.com" {
+		t.Errorf("should keep email variable, got %v", vars["email"])
+	}
+	if vars["password"] != FILTERED {
+		t.Errorf("should filter password variable, got %v", vars["password"])
+	}
+	input := vars["input"].(map[string]interface{})
+	if input["name"] != "alice" || input["secret_token"] != FILTERED {
+		t.Errorf("should filter nested variables, got %v", input)
+	}
+	users := vars["users"].([]interface{})
+	if user := users[0].(map[string]interface{}); user["name"] != "bob" || user["password"] != FILTERED {
+		t.Errorf("should filter variables in lists, got %v", user)
+	}
+	if users[1] != "carol" {
+		t.Errorf("should keep list values, got %v", users[1])
+	}
+
+	if variables["password"] != "hunter2" {
+		t.Error("should not modify the given variables")
+	}
+	if variables["users"].([]interface{})[0].(map[string]interface{})["password"] != "hunter3" {
+		t.Error("should not modify lists in the given variables")
+	}
+
+	fields = append(GraphQLFields("", nil), &Field{
+		Name: "custom",
+		Data: map[string]string{"NAME1": "VALUE1"},
+	})
+	data = buildError(ERR, errors.New("test"), BuildStack(0), fields...)["data"].(map[string]interface{})
+	if _, ok := data["context"]; ok {
+		t.Errorf("should not set context for anonymous operations, got %v", data["context"])
+	}
+	custom = data["custom"].(map[string]interface{})
+	if custom["NAME1"] != "VALUE1" || custom["graphql"] == nil {
+		t.Errorf("should merge map[string]string custom fields with graphql, got %v", custom)
+	}
+}
@@ -1,6 +1,8 @@
 package rollbar
 
 import (
+	"fmt"
+	"hash/crc32"
 	"os"
 	"runtime"
 	"strings"
@@ -55,6 +57,19 @@ func BuildStackWithCallers(callers []uintptr) Stack {
 	return stack
 }
 
+// fingerprint builds a fingerprint from the given environment, error class,
+// and stacktrace file and method names. Line numbers are left out so that
+// deploys which only move code around don't split groups. Fields are
+// NUL-separated so that adjacent values can't run together.
+func fingerprint(environment, class string, stack Stack) string {
+	hash := crc32.NewIEEE()
+	fmt.Fprintf(hash, "%s\x00%s\x00", environment, class)
+	for _, frame := range stack {
+		fmt.Fprintf(hash, "%s\x00%s\x00", frame.Filename, frame.Method)
+	}
+	return fmt.Sprintf("%x", hash.Sum32())
+}
+
 // Remove un-needed information from the source file path. This makes them
 // shorter in Rollbar UI as well as making them the same, regardless of the
 // machine the code was compiled on.
@@ -51,3 +51,22 @@ func TestShortenFilePath(t *testing.T) {
 		}
 	}
 }
+
+func TestFingerprint(t *testing.T) {
+	stack := Stack{{"foo.go", "rollbar.Foo", 12}}
+	if fingerprint("test", "errors.errorString", stack) == fingerprint("test", "rollbar.CustomError", stack) {
+		t.Error("should differ across error classes")
+	}
+
+	// Without separators these frames would hash the same input.
+	a := Stack{{"foo.go", "rollbar.Foo", 0}, {"bar.go", "rollbar.Bar", 0}}
+	b := Stack{{"foo.go", "rollbar.Foobar.go", 0}, {"", "rollbar.Bar", 0}}
+	if fingerprint("test", "", a) == fingerprint("test", "", b) {
+		t.Error("should differ across frames")
+	}
+
+	moved := Stack{{"foo.go", "rollbar.Foo", 40}, {"bar.go", "rollbar.Bar", 7}}
+	if fingerprint("test", "", a) != fingerprint("test", "", moved) {
+		t.Error("should ignore line numbers")
+	}
+}
@@ -0,0 +1,139 @@
+package rollbar
+
+import (
+	"fmt"
+)
+
+var validLevels = map[string]bool{
+	CRIT:  true,
+	ERR:   true,
+	WARN:  true,
+	INFO:  true,
+	DEBUG: true,
+}
+
+var (
+	// optionalStrings are the optional item data keys that must be strings
+	// when present.
+	optionalStrings = []string{
+		"title",
+		"platform",
+		"language",
+		"language_version",
+		"framework",
+		"code_version",
+		"context",
+		"fingerprint",
+	}
+
+	// optionalObjects are the optional item data keys that must be objects
+	// when present.
+	optionalObjects = []string{
+		"server",
+		"notifier",
+		"request",
+		"person",
+		"custom",
+	}
+)
+
+// validateBody checks a built JSON body against the parts of the Rollbar item
+// schema that this package produces and returns a description of each
+// violation found. A valid body returns no errors.
+func validateBody(body map[string]interface{}) []error {
+	var errs []error
+	fail := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if _, ok := body["access_token"].(string); !ok {
+		fail("access_token: must be a string")
+	}
+
+	data, ok := body["data"].(map[string]interface{})
+	if !ok {
+		fail("data: must be an object")
+		return errs
+	}
+
+	if env, ok := data["environment"].(string); !ok || env == "" {
+		fail("data.environment: must be a non-empty string")
+	}
+	if level, ok := data["level"].(string); !ok || !validLevels[level] {
+		fail("data.level: %v is not a valid level", data["level"])
+	}
+	if _, ok := data["timestamp"].(int64); !ok {
+		fail("data.timestamp: must be an integer")
+	}
+	for _, key := range optionalStrings {
+		if value, ok := data[key]; ok {
+			if _, ok := value.(string); !ok {
+				fail("data.%s: must be a string", key)
+			}
+		}
+	}
+	for _, key := range optionalObjects {
+		if value, ok := data[key]; ok {
+			if _, ok := stringMap(value); !ok {
+				fail("data.%s: must be an object", key)
+			}
+		}
+	}
+
+	itemBody, ok := data["body"].(map[string]interface{})
+	if !ok {
+		fail("data.body: must be an object")
+		return errs
+	}
+
+	trace, hasTrace := itemBody["trace"]
+	message, hasMessage := itemBody["message"]
+	switch {
+	case hasTrace && hasMessage:
+		fail("data.body: must have only one of trace or message")
+	case hasTrace:
+		validateTrace(trace, fail)
+	case hasMessage:
+		if m, ok := message.(map[string]interface{}); !ok {
+			fail("data.body.message: must be an object")
+		} else if _, ok := m["body"].(string); !ok {
+			fail("data.body.message.body: must be a string")
+		}
+	default:
+		fail("data.body: must have one of trace or message")
+	}
+
+	return errs
+}
+
+func validateTrace(trace interface{}, fail func(string, ...interface{})) {
+	t, ok := trace.(map[string]interface{})
+	if !ok {
+		fail("data.body.trace: must be an object")
+		return
+	}
+
+	frames, ok := t["frames"].(Stack)
+	if !ok {
+		fail("data.body.trace.frames: must be a list of frames")
+	}
+	for i, frame := range frames {
+		if frame.Filename == "" {
+			fail("data.body.trace.frames[%d].filename: must be a non-empty string", i)
+		}
+	}
+
+	exception, ok := t["exception"].(map[string]interface{})
+	if !ok {
+		fail("data.body.trace.exception: must be an object")
+		return
+	}
+	if class, ok := exception["class"].(string); !ok || class == "" {
+		fail("data.body.trace.exception.class: must be a non-empty string")
+	}
+	if message, ok := exception["message"]; ok {
+		if _, ok := message.(string); !ok {
+			fail("data.body.trace.exception.message: must be a string")
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package rollbar
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidateBody(t *testing.T) {
+	valid := []map[string]interface{}{
+		buildError(ERR, errors.New("test"), BuildStack(0)),
+		buildError(ERR, nil, BuildStack(0)),
+		buildMessage(INFO, "test"),
+		buildMessage(INFO, "test",
+			&Field{Name: "person", Data: map[string]string{"id": "42"}},
+			&Field{Name: "custom", Data: map[string]string{"NAME1": "VALUE1"}},
+			&Field{Name: "context", Data: "billing#charge"},
+		),
+	}
+	for i, body := range valid {
+		if errs := validateBody(body); len(errs) != 0 {
+			t.Errorf("valid[%d]: got %v", i, errs)
+		}
+	}
+
+	tests := []struct {
+		Mutate   func(data map[string]interface{})
+		Expected string
+	}{
+		{func(d map[string]interface{}) { d["level"] = "fatal" }, "data.level: fatal is not a valid level"},
+		{func(d map[string]interface{}) { d["environment"] = "" }, "data.environment: must be a non-empty string"},
+		{func(d map[string]interface{}) { d["timestamp"] = "now" }, "data.timestamp: must be an integer"},
+		{func(d map[string]interface{}) { d["title"] = 42 }, "data.title: must be a string"},
+		{func(d map[string]interface{}) { d["platform"] = 1 }, "data.platform: must be a string"},
+		{func(d map[string]interface{}) { d["language"] = 1 }, "data.language: must be a string"},
+		{func(d map[string]interface{}) { d["language_version"] = 1.12 }, "data.language_version: must be a string"},
+		{func(d map[string]interface{}) { d["framework"] = []string{"gin"} }, "data.framework: must be a string"},
+		{func(d map[string]interface{}) { d["code_version"] = 3 }, "data.code_version: must be a string"},
+		{func(d map[string]interface{}) { d["context"] = 42 }, "data.context: must be a string"},
+		{func(d map[string]interface{}) { d["fingerprint"] = 0xabc }, "data.fingerprint: must be a string"},
+		{func(d map[string]interface{}) { d["server"] = "localhost" }, "data.server: must be an object"},
+		{func(d map[string]interface{}) { d["notifier"] = NAME }, "data.notifier: must be an object"},
+		{func(d map[string]interface{}) { d["request"] = []string{"GET"} }, "data.request: must be an object"},
+		{func(d map[string]interface{}) { d["person"] = 42 }, "data.person: must be an object"},
+		{func(d map[string]interface{}) { d["custom"] = "value" }, "data.custom: must be an object"},
+		{func(d map[string]interface{}) { delete(d, "body") }, "data.body: must be an object"},
+		{func(d map[string]interface{}) { d["body"] = map[string]interface{}{} }, "data.body: must have one of trace or message"},
+		{func(d map[string]interface{}) {
+			d["body"].(map[string]interface{})["message"] = messageBody("test")["message"]
+		}, "data.body: must have only one of trace or message"},
+		{func(d map[string]interface{}) {
+			trace := d["body"].(map[string]interface{})["trace"].(map[string]interface{})
+			trace["exception"].(map[string]interface{})["class"] = ""
+		}, "data.body.trace.exception.class: must be a non-empty string"},
+		{func(d map[string]interface{}) {
+			d["body"].(map[string]interface{})["trace"].(map[string]interface{})["frames"] = "main.go:1"
+		}, "data.body.trace.frames: must be a list of frames"},
+		{func(d map[string]interface{}) {
+			d["body"].(map[string]interface{})["trace"].(map[string]interface{})["frames"] = Stack{
+				{"main.go", "main.main", 1},
+				{"", "main.run", 2},
+			}
+		}, "data.body.trace.frames[1].filename: must be a non-empty string"},
+	}
+	for i, test := range tests {
+		body := buildError(ERR, errors.New("test"), BuildStack(0))
+		test.Mutate(body["data"].(map[string]interface{}))
+
+		errs := validateBody(body)
+		if len(errs) != 1 || errs[0].Error() != test.Expected {
+			t.Errorf("tests[%d]: got %v", i, errs)
+		}
+	}
+
+	if errs := validateBody(map[string]interface{}{}); len(errs) != 2 {
+		t.Errorf("got %v", errs)
+	}
+}
+
+func TestValidatePayloads(t *testing.T) {
+	bckValidate, bckWriter, bckToken := ValidatePayloads, ErrorWriter, Token
+	defer func() {
+		ValidatePayloads, ErrorWriter, Token = bckValidate, bckWriter, bckToken
+	}()
+
+	var out bytes.Buffer
+	ValidatePayloads, ErrorWriter, Token = true, &out, ""
+
+	body := buildMessage(INFO, "test")
+	body["data"].(map[string]interface{})["level"] = "verbose"
+	post(body)
+
+	if !strings.Contains(out.String(), "invalid payload: data.level: verbose is not a valid level") {
+		t.Errorf("got output: %q", out.String())
+	}
+}